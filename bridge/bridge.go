@@ -0,0 +1,196 @@
+// Package bridge flattens Prometheus metric families into Graphite
+// plaintext lines and publishes them through an existing g2g.Graphite,
+// so a process that already exposes a prometheus.Gatherer doesn't need
+// a second connection or a second publish loop to also feed Carbon.
+package bridge
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/henrypfhu/g2g"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// ErrorPolicy controls how a Bridge handles an error returned by the
+// wrapped Gatherer's Gather call.
+type ErrorPolicy int
+
+const (
+	// ContinueOnError flattens every metric family Gather did return,
+	// ignoring the error. This is the default.
+	ContinueOnError ErrorPolicy = iota
+	// AbortOnError discards the whole push cycle if Gather reports any
+	// problem, rather than publishing a partial/inconsistent set.
+	AbortOnError
+)
+
+// TagMode selects how Prometheus label pairs are rendered in a
+// flattened Graphite metric name.
+type TagMode int
+
+const (
+	// PathTags appends each label as a dot-joined path segment, e.g.
+	// "http_requests.code.200.method.get". This is the default.
+	PathTags TagMode = iota
+	// GraphiteTags appends each label using Graphite 1.1 tag syntax,
+	// e.g. "http_requests;code=200;method=get", matching g2g's own
+	// Graphite.RegisterWithTags.
+	GraphiteTags
+)
+
+// Bridge adapts a prometheus.Gatherer to g2g.MultiVar, so a single
+// Graphite.RegisterMulti call flattens every metric family it gathers
+// into Graphite lines each publish interval.
+type Bridge struct {
+	gatherer    prometheus.Gatherer
+	errorPolicy ErrorPolicy
+	tagMode     TagMode
+	separator   string
+}
+
+// New returns a Bridge over gatherer with ContinueOnError semantics and
+// dot-joined (PathTags) label rendering.
+func New(gatherer prometheus.Gatherer) *Bridge {
+	return &Bridge{
+		gatherer:    gatherer,
+		errorPolicy: ContinueOnError,
+		tagMode:     PathTags,
+		separator:   ";",
+	}
+}
+
+// WithErrorPolicy sets how Gather errors are handled and returns b for
+// chaining.
+func (b *Bridge) WithErrorPolicy(p ErrorPolicy) *Bridge {
+	b.errorPolicy = p
+	return b
+}
+
+// WithTagMode sets how labels are rendered and returns b for chaining.
+func (b *Bridge) WithTagMode(mode TagMode) *Bridge {
+	b.tagMode = mode
+	return b
+}
+
+// WithTagSeparator sets the separator written before each label in
+// GraphiteTags mode and returns b for chaining. Defaults to ";".
+func (b *Bridge) WithTagSeparator(sep string) *Bridge {
+	b.separator = sep
+	return b
+}
+
+// RegisterInto registers b as a single MultiVar under name on g, so
+// every metric family b's Gatherer reports is flattened to Graphite
+// lines on g's regular publish interval, through g's existing
+// connection and reconnect machinery.
+func (b *Bridge) RegisterInto(g *g2g.Graphite, name string) {
+	g.RegisterMulti(name, b)
+}
+
+// Strings implements g2g.MultiVar: it gathers the wrapped Gatherer and
+// flattens every metric family into suffix -> value pairs.
+func (b *Bridge) Strings() map[string]string {
+	families, err := b.gatherer.Gather()
+	if err != nil && b.errorPolicy == AbortOnError {
+		return nil
+	}
+	out := map[string]string{}
+	for _, mf := range families {
+		b.flattenFamily(mf, out)
+	}
+	return out
+}
+
+// flattenFamily writes every metric in mf into out, keyed by the
+// family's name plus a label suffix and, for histograms/summaries, a
+// component suffix (.count, .sum, .bucket.<le>, .quantile.<q>). In
+// PathTags mode the component follows the labels; in GraphiteTags mode
+// it precedes the tag block, so it stays part of the metric name.
+func (b *Bridge) flattenFamily(mf *dto.MetricFamily, out map[string]string) {
+	name := mf.GetName()
+	for _, m := range mf.GetMetric() {
+		labels := b.labelSuffix(m.GetLabel())
+		key := func(component string) string {
+			if b.tagMode == GraphiteTags {
+				return name + component + labels
+			}
+			return name + labels + component
+		}
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			out[key("")] = formatFloat(m.GetCounter().GetValue())
+		case dto.MetricType_GAUGE:
+			out[key("")] = formatFloat(m.GetGauge().GetValue())
+		case dto.MetricType_HISTOGRAM:
+			h := m.GetHistogram()
+			out[key(".count")] = formatUint(h.GetSampleCount())
+			out[key(".sum")] = formatFloat(h.GetSampleSum())
+			for _, bucket := range h.GetBucket() {
+				out[key(".bucket."+formatPathFloat(bucket.GetUpperBound()))] = formatUint(bucket.GetCumulativeCount())
+			}
+		case dto.MetricType_SUMMARY:
+			s := m.GetSummary()
+			out[key(".count")] = formatUint(s.GetSampleCount())
+			out[key(".sum")] = formatFloat(s.GetSampleSum())
+			for _, q := range s.GetQuantile() {
+				out[key(".quantile."+formatPathFloat(q.GetQuantile()))] = formatFloat(q.GetValue())
+			}
+		}
+	}
+}
+
+// labelSuffix renders m's labels according to the Bridge's TagMode.
+// Labels are sorted by name first so the rendered name is deterministic.
+func (b *Bridge) labelSuffix(labels []*dto.LabelPair) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].GetName() < labels[j].GetName() })
+	var sb strings.Builder
+	for _, lp := range labels {
+		switch b.tagMode {
+		case GraphiteTags:
+			sb.WriteString(b.separator)
+			sb.WriteString(lp.GetName())
+			sb.WriteByte('=')
+			sb.WriteString(lp.GetValue())
+		default: // PathTags
+			sb.WriteByte('.')
+			sb.WriteString(lp.GetName())
+			sb.WriteByte('.')
+			sb.WriteString(lp.GetValue())
+		}
+	}
+	return sb.String()
+}
+
+func formatFloat(v float64) string {
+	if math.IsNaN(v) {
+		return "nan"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// formatPathFloat renders v for use inside a Graphite path segment (a
+// histogram bucket bound or summary quantile), where the "+Inf" bucket
+// every Prometheus histogram has, or the "+"/"-" from 'g'-format
+// exponential notation, would land in the path verbatim.
+func formatPathFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "inf"
+	case math.IsInf(v, -1):
+		return "-inf"
+	case math.IsNaN(v):
+		return "nan"
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func formatUint(v uint64) string {
+	return strconv.FormatUint(v, 10)
+}
@@ -0,0 +1,99 @@
+package bridge
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// fakeGatherer returns a fixed set of families, so tests can exercise
+// shapes (like an explicit +Inf bucket) that client_golang's own
+// Registry keeps implicit but that other Gatherer implementations -
+// e.g. ones rebuilt from scraped/federated text - populate explicitly.
+type fakeGatherer struct {
+	families []*dto.MetricFamily
+}
+
+func (f fakeGatherer) Gather() ([]*dto.MetricFamily, error) {
+	return f.families, nil
+}
+
+func TestBridgeStringsFlattensFamilies(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "requests_total"})
+	counter.Add(3)
+	reg.MustRegister(counter)
+
+	hist := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "latency_seconds",
+		Buckets: []float64{0.1, 1},
+	})
+	hist.Observe(0.5)
+	reg.MustRegister(hist)
+
+	b := New(reg)
+	out := b.Strings()
+
+	if got, want := out["requests_total"], "3"; got != want {
+		t.Errorf("requests_total = %q, want %q", got, want)
+	}
+	if _, ok := out["latency_seconds.count"]; !ok {
+		t.Errorf("missing latency_seconds.count, got %+v", out)
+	}
+}
+
+func TestBridgeStringsRendersInfBucketSafely(t *testing.T) {
+	families := []*dto.MetricFamily{{
+		Name: strPtr("latency_seconds"),
+		Type: dto.MetricType_HISTOGRAM.Enum(),
+		Metric: []*dto.Metric{{
+			Histogram: &dto.Histogram{
+				SampleCount: uint64Ptr(2),
+				SampleSum:   float64Ptr(1.5),
+				Bucket: []*dto.Bucket{
+					{UpperBound: float64Ptr(1), CumulativeCount: uint64Ptr(1)},
+					{UpperBound: float64Ptr(math.Inf(1)), CumulativeCount: uint64Ptr(2)},
+				},
+			},
+		}},
+	}}
+
+	out := New(fakeGatherer{families}).Strings()
+
+	for k := range out {
+		if strings.Contains(k, "+") {
+			t.Errorf("path segment %q contains a literal '+'", k)
+		}
+	}
+	if _, ok := out["latency_seconds.bucket.inf"]; !ok {
+		t.Errorf("expected latency_seconds.bucket.inf, got %+v", out)
+	}
+}
+
+func strPtr(s string) *string       { return &s }
+func uint64Ptr(v uint64) *uint64    { return &v }
+func float64Ptr(v float64) *float64 { return &v }
+
+func TestFormatPathFloatAvoidsExponentAndInf(t *testing.T) {
+	cases := map[float64]string{
+		1e6:  "1000000",
+		1e-9: "0.000000001",
+		0.5:  "0.5",
+		-1e6: "-1000000",
+	}
+	for in, want := range cases {
+		if got := formatPathFloat(in); got != want {
+			t.Errorf("formatPathFloat(%v) = %q, want %q", in, got, want)
+		}
+	}
+	if got := formatPathFloat(math.Inf(1)); got != "inf" {
+		t.Errorf("formatPathFloat(+Inf) = %q, want %q", got, "inf")
+	}
+	if got := formatPathFloat(math.Inf(-1)); got != "-inf" {
+		t.Errorf("formatPathFloat(-Inf) = %q, want %q", got, "-inf")
+	}
+}
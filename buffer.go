@@ -0,0 +1,173 @@
+package g2g
+
+import (
+	"bufio"
+	"bytes"
+	"expvar"
+	"fmt"
+	"log"
+	"time"
+)
+
+// OnFullPolicy controls what happens to a new publish batch when the
+// pending queue is already at its configured QueueSize.
+type OnFullPolicy int
+
+const (
+	// DropOldest discards the longest-queued batch to make room for the
+	// new one. This is the default: it favors fresh data over stale
+	// data once the queue backs up.
+	DropOldest OnFullPolicy = iota
+	// DropNewest discards the batch that was about to be queued,
+	// leaving the existing queue untouched.
+	DropNewest
+	// Block makes the publisher wait until writeLoop has drained room
+	// in the queue, or until Shutdown is called. Use with a bounded
+	// QueueSize to apply backpressure instead of dropping data.
+	Block
+)
+
+// Stats exposes self-metrics about a Graphite's publishing. Register it
+// back into the same (or another) Graphite via its fields if you want
+// these counters published alongside your own.
+type Stats struct {
+	Sent       *expvar.Int
+	Dropped    *expvar.Int
+	Reconnects *expvar.Int
+}
+
+func newStats() *Stats {
+	return &Stats{
+		Sent:       new(expvar.Int),
+		Dropped:    new(expvar.Int),
+		Reconnects: new(expvar.Int),
+	}
+}
+
+// Stats returns the Graphite's self-metric counters: batches sent,
+// batches dropped (queue overflow, or given up at shutdown), and
+// successful endpoint dials, the initial connection included.
+func (g *Graphite) Stats() *Stats {
+	return g.stats
+}
+
+// buildBatch serializes every Registered var into a single buffer, one
+// "name value timestamp" line per var (or, for a MultiVar, one line per
+// suffixed value), ready for a single Write.
+func (g *Graphite) buildBatch() []byte {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	now := time.Now().Unix()
+	for name, v := range g.vars {
+		switch val := v.(type) {
+		case MultiVar:
+			for suffix, s := range val.Strings() {
+				fmt.Fprintf(w, "%s%s %s %d\n", name, suffix, s, now)
+			}
+		case expvar.Var:
+			fmt.Fprintf(w, "%s %s %d\n", name, val.String(), now)
+		}
+	}
+	w.Flush()
+	return buf.Bytes()
+}
+
+// enqueue adds batch to the pending queue, applying the configured
+// OnFull policy if the queue is already at capacity. Empty batches (no
+// vars Registered yet) are dropped silently.
+//
+// enqueue runs synchronously on the same goroutine as loop() (and on
+// writeLoop's, for a retried batch), so a Block-policy wait here must
+// stay escapable: it also selects on
+// g.closing, which Shutdown closes before anything else, so Shutdown
+// can never deadlock waiting for a publish that will never drain.
+func (g *Graphite) enqueue(batch []byte) {
+	if len(batch) == 0 {
+		return
+	}
+	switch g.onFull {
+	case Block:
+		select {
+		case g.queue <- batch:
+		case <-g.closing:
+			g.stats.Dropped.Add(1)
+		}
+	case DropNewest:
+		select {
+		case g.queue <- batch:
+		default:
+			g.stats.Dropped.Add(1)
+		}
+	default: // DropOldest
+		for {
+			select {
+			case g.queue <- batch:
+				return
+			default:
+			}
+			select {
+			case <-g.queue:
+				g.stats.Dropped.Add(1)
+			default:
+			}
+		}
+	}
+}
+
+// retryBackoff is how long writeLoop waits before re-enqueueing a batch
+// that failed to write, so a down endpoint isn't hammered in a tight
+// loop while outage data is held for retry.
+const retryBackoff = 250 * time.Millisecond
+
+// writeLoop drains the pending queue and writes each batch to the
+// cluster. A batch that fails to write is re-enqueued after a short
+// backoff, subject to the same OnFull policy as any new batch, so a
+// short outage doesn't drop an interval's data on its first attempt.
+// writeLoop stops once g.closing is closed, flushing whatever is
+// already queued on a best-effort basis first.
+func (g *Graphite) writeLoop() {
+	for {
+		select {
+		case batch := <-g.queue:
+			g.writeOrRetry(batch)
+		case <-g.closing:
+			g.drainOnShutdown()
+			close(g.writerDone)
+			return
+		}
+	}
+}
+
+// writeOrRetry writes batch once; on failure it re-enqueues the batch
+// after retryBackoff instead of dropping it.
+func (g *Graphite) writeOrRetry(batch []byte) {
+	if err := g.writeBatch(batch); err != nil {
+		log.Printf("g2g: %s", err)
+		select {
+		case <-time.After(retryBackoff):
+			g.enqueue(batch)
+		case <-g.closing:
+			g.stats.Dropped.Add(1)
+		}
+		return
+	}
+	g.stats.Sent.Add(1)
+}
+
+// drainOnShutdown makes one write attempt per already-queued batch,
+// without retrying failures, so Shutdown doesn't wait on an outage.
+func (g *Graphite) drainOnShutdown() {
+	for {
+		select {
+		case batch := <-g.queue:
+			if err := g.writeBatch(batch); err != nil {
+				log.Printf("g2g: %s", err)
+				g.stats.Dropped.Add(1)
+				continue
+			}
+			g.stats.Sent.Add(1)
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package g2g
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeDialerFunc adapts a plain function to the Dialer interface.
+type fakeDialerFunc func(network, address string) (net.Conn, error)
+
+func (f fakeDialerFunc) Dial(network, address string) (net.Conn, error) {
+	return f(network, address)
+}
+
+// fakeConn is a minimal net.Conn whose Write behavior is injectable.
+type fakeConn struct {
+	net.Conn
+	onWrite func(b []byte) (int, error)
+}
+
+func (c *fakeConn) Write(b []byte) (int, error)      { return c.onWrite(b) }
+func (c *fakeConn) Close() error                     { return nil }
+func (c *fakeConn) SetWriteDeadline(time.Time) error { return nil }
+
+// TestWriteLoopRetriesFailedBatch guards against a batch being dropped
+// on its first failed write: it should be re-enqueued and eventually
+// sent once the endpoint recovers, not discarded.
+func TestWriteLoopRetriesFailedBatch(t *testing.T) {
+	var attempts int32
+	dialer := fakeDialerFunc(func(network, address string) (net.Conn, error) {
+		return &fakeConn{onWrite: func(b []byte) (int, error) {
+			if atomic.AddInt32(&attempts, 1) == 1 {
+				return 0, fmt.Errorf("simulated failure")
+			}
+			return len(b), nil
+		}}, nil
+	})
+
+	g := &Graphite{
+		endpoints:     []string{"retry-test:0"},
+		protocol:      "tcp",
+		dialer:        dialer,
+		timeout:       time.Second,
+		endpointConns: make([]net.Conn, 1),
+		queue:         make(chan []byte, 1),
+		onFull:        DropOldest,
+		closing:       make(chan struct{}),
+		writerDone:    make(chan struct{}),
+		stats:         newStats(),
+	}
+	go g.writeLoop()
+	g.queue <- []byte("a.b.c 1 1\n")
+
+	deadline := time.After(2 * time.Second)
+	for g.stats.Sent.Value() == 0 {
+		select {
+		case <-deadline:
+			t.Fatalf("batch never sent after retry; attempts=%d sent=%d dropped=%d",
+				atomic.LoadInt32(&attempts), g.stats.Sent.Value(), g.stats.Dropped.Value())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	if got := atomic.LoadInt32(&attempts); got < 2 {
+		t.Fatalf("write attempts = %d, want at least 2 (initial failure + retry)", got)
+	}
+	if got := g.stats.Dropped.Value(); got != 0 {
+		t.Fatalf("Dropped = %d, want 0: a retried batch must not count as dropped", got)
+	}
+
+	close(g.closing)
+	<-g.writerDone
+}
@@ -0,0 +1,88 @@
+package g2g
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// failoverDialer dials "down:0" to a connection whose every Write
+// fails, and any other address to a connection that records the bytes
+// it was given and succeeds.
+type failoverDialer struct {
+	written [][]byte
+}
+
+func (d *failoverDialer) Dial(network, address string) (net.Conn, error) {
+	if address == "down:0" {
+		return &fakeConn{onWrite: func(b []byte) (int, error) {
+			return 0, fmt.Errorf("endpoint %s is down", address)
+		}}, nil
+	}
+	return &fakeConn{onWrite: func(b []byte) (int, error) {
+		d.written = append(d.written, append([]byte(nil), b...))
+		return len(b), nil
+	}}, nil
+}
+
+// TestWriteBatchFailsOverToNextEndpoint guards against writeBatch
+// giving up when the endpoint it happens to start at is down: it
+// should fail over to the next endpoint in the cluster instead of
+// losing the batch.
+func TestWriteBatchFailsOverToNextEndpoint(t *testing.T) {
+	dialer := &failoverDialer{}
+	g := &Graphite{
+		endpoints:     []string{"down:0", "up:0"},
+		protocol:      "tcp",
+		dialer:        dialer,
+		endpointConns: make([]net.Conn, 2),
+		stats:         newStats(),
+	}
+
+	// Run enough times that writeBatch's random starting endpoint
+	// covers both possibilities; every run must still succeed.
+	for i := 0; i < 20; i++ {
+		g.endpointConns[0] = nil
+		g.endpointConns[1] = nil
+		if err := g.writeBatch([]byte("a.b.c 1 1\n")); err != nil {
+			t.Fatalf("writeBatch() = %v, want success via failover", err)
+		}
+	}
+
+	if len(dialer.written) == 0 {
+		t.Fatalf("the healthy endpoint never received a write")
+	}
+	for _, b := range dialer.written {
+		if string(b) != "a.b.c 1 1\n" {
+			t.Fatalf("endpoint received %q, want %q", b, "a.b.c 1 1\n")
+		}
+	}
+}
+
+// TestConfigDialerWiring guards against Config's accessor methods
+// silently ignoring the fields NewGraphiteCluster relies on: a custom
+// Dialer must take priority over the netDialer default, and the
+// default netDialer must itself carry through TLSConfig and
+// DialTimeout.
+func TestConfigDialerWiring(t *testing.T) {
+	custom := &failoverDialer{}
+	cfg := &Config{Dialer: custom}
+	if got := cfg.dialer(); got != custom {
+		t.Fatalf("dialer() = %v, want the Config.Dialer override", got)
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+	cfg = &Config{TLSConfig: tlsConfig, DialTimeout: 5 * time.Second}
+	nd, ok := cfg.dialer().(*netDialer)
+	if !ok {
+		t.Fatalf("dialer() = %T, want *netDialer", cfg.dialer())
+	}
+	if nd.tlsConfig != tlsConfig {
+		t.Fatalf("netDialer.tlsConfig not wired from Config.TLSConfig")
+	}
+	if nd.dialer.Timeout != 5*time.Second {
+		t.Fatalf("netDialer dial timeout = %v, want 5s", nd.dialer.Timeout)
+	}
+}
@@ -0,0 +1,29 @@
+package g2g
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+)
+
+// TestNetDialerSkipsTLSForUDP guards against netDialer wrapping a UDP
+// connection in TLS: Config.TLSConfig documents itself as ignored for
+// the "udp" protocol, so Dial must not attempt a TLS handshake over it.
+func TestNetDialerSkipsTLSForUDP(t *testing.T) {
+	ln, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+	defer ln.Close()
+
+	d := &netDialer{tlsConfig: &tls.Config{InsecureSkipVerify: true}}
+	conn, err := d.Dial("udp", ln.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+
+	if _, ok := conn.(*tls.Conn); ok {
+		t.Fatalf("Dial wrapped a udp connection in TLS despite it being documented as ignored")
+	}
+}
@@ -1,31 +1,175 @@
 package g2g
 
 import (
+	"crypto/tls"
+	"expvar"
 	"fmt"
-	"time"
+	"math/rand"
 	"net"
-	"expvar"
-	"log"
+	"sort"
+	"strings"
+	"time"
 )
 
-// Graphite represents a Graphite server. You Register expvars
-// in this struct, which will be published to the server on a
-// regular interval.
+// Dialer establishes connections to a Graphite's endpoints. Supply a
+// custom implementation via Config.Dialer for tests or alternate
+// transports.
+type Dialer interface {
+	Dial(network, address string) (net.Conn, error)
+}
+
+// netDialer is the default Dialer, backed by net.Dialer and, optionally,
+// TLS.
+type netDialer struct {
+	dialer    net.Dialer
+	tlsConfig *tls.Config
+}
+
+func (d *netDialer) Dial(network, address string) (net.Conn, error) {
+	if d.tlsConfig != nil && network != "udp" {
+		return tls.DialWithDialer(&d.dialer, network, address, d.tlsConfig)
+	}
+	return d.dialer.Dial(network, address)
+}
+
+// Config controls how a Graphite struct talks to its Carbon endpoint(s).
+// The zero value is a ready to use Config that dials plain TCP with no
+// timeout and no TLS.
+type Config struct {
+	// Protocol is the network passed to the Dialer, e.g. "tcp" or "udp".
+	// Carbon accepts both. Defaults to "tcp".
+	Protocol string
+
+	// TLSConfig, if non-nil, wraps each TCP connection in TLS. It is
+	// ignored when Protocol is "udp".
+	TLSConfig *tls.Config
+
+	// DialTimeout bounds how long a single endpoint dial may take.
+	// Zero means no timeout.
+	DialTimeout time.Duration
+
+	// Dialer, if set, is used instead of the default net/tls-backed
+	// dialer. This is the extension point for tests and for users who
+	// want pooling, instrumentation, or an entirely different transport.
+	Dialer Dialer
+
+	// Prefix, if set, is prepended to every registered metric path.
+	Prefix string
+
+	// NameMapper, if set, is applied to every registered name before
+	// Prefix is prepended, e.g. to sanitize characters Graphite treats
+	// specially.
+	NameMapper func(string) string
+
+	// TagSeparator is the character sequence placed between a metric's
+	// base name and its tag block in RegisterWithTags, following the
+	// Graphite 1.1 "name;tag=value" convention. Defaults to ";".
+	TagSeparator string
+
+	// QueueSize bounds how many pending publish batches may accumulate
+	// while all endpoints are unreachable. Defaults to 1, i.e. one batch
+	// may wait while writeLoop is writing (or retrying) another.
+	QueueSize int
+
+	// OnFull controls what happens to a new batch when the queue is
+	// already at QueueSize. Defaults to DropOldest.
+	OnFull OnFullPolicy
+}
+
+func (c *Config) protocol() string {
+	if c == nil || c.Protocol == "" {
+		return "tcp"
+	}
+	return c.Protocol
+}
+
+func (c *Config) prefix() string {
+	if c == nil {
+		return ""
+	}
+	return c.Prefix
+}
+
+func (c *Config) nameMapper() func(string) string {
+	if c == nil {
+		return nil
+	}
+	return c.NameMapper
+}
+
+func (c *Config) tagSeparator() string {
+	if c == nil || c.TagSeparator == "" {
+		return ";"
+	}
+	return c.TagSeparator
+}
+
+func (c *Config) queueSize() int {
+	if c == nil || c.QueueSize <= 0 {
+		return 1
+	}
+	return c.QueueSize
+}
+
+func (c *Config) onFull() OnFullPolicy {
+	if c == nil {
+		return DropOldest
+	}
+	return c.OnFull
+}
+
+func (c *Config) dialer() Dialer {
+	if c != nil && c.Dialer != nil {
+		return c.Dialer
+	}
+	var tlsConfig *tls.Config
+	var dialTimeout time.Duration
+	if c != nil {
+		tlsConfig = c.TLSConfig
+		dialTimeout = c.DialTimeout
+	}
+	return &netDialer{
+		dialer:    net.Dialer{Timeout: dialTimeout},
+		tlsConfig: tlsConfig,
+	}
+}
+
+// Graphite represents a (possibly load-balanced) set of Graphite/Carbon
+// endpoints. You Register expvars in this struct, which will be
+// published to one of the endpoints on a regular interval.
 type Graphite struct {
-	endpoint      string
+	endpoints     []string
+	protocol      string
+	dialer        Dialer
+	prefix        string
+	nameMapper    func(string) string
+	tagSeparator  string
 	interval      time.Duration
 	timeout       time.Duration
 	lastPublish   time.Time
-	connection    net.Conn
-	vars          map[string]expvar.Var
+	endpointConns []net.Conn
+	vars          map[string]interface{}
 	registrations chan namedVar
 	shutdown      chan chan bool
+	queue         chan []byte
+	onFull        OnFullPolicy
+	closing       chan struct{}
+	writerDone    chan struct{}
+	stats         *Stats
+}
+
+// MultiVar expands into more than one Graphite line per Register call,
+// keyed by a suffix appended to the registered name (e.g. ".count",
+// ".bucket.0.5").
+type MultiVar interface {
+	Strings() map[string]string
 }
 
-// A namedVar couples an expvar (interface) with an "external" name.
+// A namedVar couples a registered value (an expvar.Var or a MultiVar)
+// with an "external" name.
 type namedVar struct {
 	name string
-	v    expvar.Var
+	v    interface{}
 }
 
 // NewGraphite returns a Graphite structure with an open and working
@@ -33,34 +177,114 @@ type namedVar struct {
 // Endpoint should be of the format "host:port", eg. "stats:2003".
 // Interval is the (best-effort) minimum duration between (sequential)
 // publishments of Registered expvars. Timeout is per-publish-action.
+//
+// NewGraphite is a thin wrapper around NewGraphiteCluster for the common
+// single-endpoint, plain-TCP case.
 func NewGraphite(endpoint string, interval, timeout time.Duration) (*Graphite, error) {
+	return NewGraphiteCluster([]string{endpoint}, interval, timeout, nil)
+}
+
+// NewGraphiteCluster returns a Graphite structure that load-balances
+// publishes across the given set of "host:port" endpoints, picking a
+// random healthy connection per publish cycle and failing over to the
+// next endpoint when a write errors. cfg may be nil to get plain-TCP
+// defaults.
+func NewGraphiteCluster(endpoints []string, interval, timeout time.Duration, cfg *Config) (*Graphite, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("g2g: no endpoints given")
+	}
 	g := &Graphite{
-		endpoint:      endpoint,
+		endpoints:     endpoints,
+		protocol:      cfg.protocol(),
+		dialer:        cfg.dialer(),
+		prefix:        cfg.prefix(),
+		nameMapper:    cfg.nameMapper(),
+		tagSeparator:  cfg.tagSeparator(),
 		interval:      interval,
 		timeout:       timeout,
 		lastPublish:   time.Now(), // baseline
-		connection:    nil,
-		vars:          map[string]expvar.Var{},
+		endpointConns: make([]net.Conn, len(endpoints)),
+		vars:          map[string]interface{}{},
 		registrations: make(chan namedVar),
 		shutdown:      make(chan chan bool),
+		queue:         make(chan []byte, cfg.queueSize()),
+		onFull:        cfg.onFull(),
+		closing:       make(chan struct{}),
+		writerDone:    make(chan struct{}),
+		stats:         newStats(),
 	}
-	if err := g.reconnect(); err != nil {
+	if err := g.reconnect(0); err != nil {
 		return nil, err
 	}
+	go g.writeLoop()
 	go g.loop()
 	return g, nil
 }
 
 // Register registers an expvar under the given name. (Roughly) every
 // interval, the current value of the given expvar will be published to
-// Graphite under the given name.
+// Graphite under the given name. The name is subject to the Graphite's
+// NameMapper and Prefix, if configured.
 func (g *Graphite) Register(name string, v expvar.Var) {
-	g.registrations <- namedVar{name, v}
+	g.registrations <- namedVar{g.renderName(name), v}
+}
+
+// RegisterWithTags registers an expvar the same way Register does, but
+// additionally attaches a set of Graphite 1.1 tags. The published line
+// takes the form "name;tag1=v1;tag2=v2 value ts", with the separator
+// character between name and tags controlled by Config.TagSeparator.
+func (g *Graphite) RegisterWithTags(name string, tags map[string]string, v expvar.Var) {
+	g.registrations <- namedVar{g.renderNameWithTags(name, tags), v}
+}
+
+// RegisterMulti registers a MultiVar under the given name. Every
+// interval, each of its suffixed values is published as its own
+// Graphite line: "<name><suffix> value ts".
+func (g *Graphite) RegisterMulti(name string, v MultiVar) {
+	g.registrations <- namedVar{g.renderName(name), v}
+}
+
+// renderName applies the configured NameMapper and Prefix to name.
+func (g *Graphite) renderName(name string) string {
+	if g.nameMapper != nil {
+		name = g.nameMapper(name)
+	}
+	return g.prefix + name
+}
+
+// renderNameWithTags applies renderName to name, then appends tags in
+// sorted-key order so the resulting metric path is deterministic.
+func (g *Graphite) renderNameWithTags(name string, tags map[string]string) string {
+	base := g.renderName(name)
+	if len(tags) == 0 {
+		return base
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(base)
+	b.WriteString(g.tagSeparator)
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(';')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(tags[k])
+	}
+	return b.String()
 }
 
 // Shutdown signals the Graphite structure to stop publishing
-// Registered expvars.
+// Registered expvars. Closing g.closing first lets a Block-policy
+// enqueue that's wedged waiting for queue room (inside loop(), on the
+// timer branch) give up immediately, so loop() can get back around to
+// servicing this request instead of hanging forever.
 func (g *Graphite) Shutdown() {
+	close(g.closing)
 	q := make(chan bool)
 	g.shutdown <- q
 	<-q
@@ -74,52 +298,78 @@ func (g *Graphite) loop() {
 		case <-time.After(g.nextPublishDelay()):
 			g.postAll()
 		case q := <-g.shutdown:
-			g.connection.Close()
-			g.connection = nil
+			<-g.writerDone
+			for i, conn := range g.endpointConns {
+				if conn != nil {
+					conn.Close()
+				}
+				g.endpointConns[i] = nil
+			}
 			q <- true
 			return
 		}
 	}
 }
 
-// postAll publishes all Registered expvars to the Graphite server.
+// postAll serializes all Registered expvars into a single batch and
+// enqueues it for publishing. The actual network write happens on
+// writeLoop, decoupling slow or unreachable endpoints from Register and
+// Shutdown calls.
 func (g *Graphite) postAll() {
-	for name, v := range g.vars {
-		if err := g.postOne(name, v.String()); err != nil {
-			log.Printf("g2g: %s: %s", name, err)
+	g.enqueue(g.buildBatch())
+	g.lastPublish = time.Now()
+}
+
+// writeBatch writes batch to one of the cluster's endpoints. It starts
+// at a random endpoint and fails over to the next one (wrapping around
+// once) if the write errors.
+func (g *Graphite) writeBatch(batch []byte) error {
+	start := rand.Intn(len(g.endpoints))
+	var lastErr error
+	for i := 0; i < len(g.endpoints); i++ {
+		idx := (start + i) % len(g.endpoints)
+		if err := g.writeTo(idx, batch); err != nil {
+			lastErr = err
+			continue
 		}
+		return nil
 	}
-	g.lastPublish = time.Now()
+	return fmt.Errorf("batch publish: all endpoints failed, last error: %s", lastErr)
 }
 
-// postOne publishes the given name-value pair to the Graphite server.
-// If the connection is broken, one reconnect attempt is made.
-func (g *Graphite) postOne(name, value string) error {
-	if g.connection == nil {
-		if err := g.reconnect(); err != nil {
+// writeTo writes b to the endpoint at idx, (re-)connecting first if
+// necessary.
+func (g *Graphite) writeTo(idx int, b []byte) error {
+	if g.endpointConns[idx] == nil {
+		if err := g.reconnect(idx); err != nil {
 			return err
 		}
 	}
+	conn := g.endpointConns[idx]
 	deadline := time.Now().Add(g.timeout)
-	if err := g.connection.SetWriteDeadline(deadline); err != nil {
+	if err := conn.SetWriteDeadline(deadline); err != nil {
 		return err
 	}
-	b := []byte(fmt.Sprintf("%s %s %d\n", name, value, time.Now().Unix()))
-	if n, err := g.connection.Write(b); err != nil {
+	if n, err := conn.Write(b); err != nil {
+		conn.Close()
+		g.endpointConns[idx] = nil
 		return err
 	} else if n != len(b) {
-		return fmt.Errorf("%s = %v: short write: %d/%d", name, value, n, len(b))
+		conn.Close()
+		g.endpointConns[idx] = nil
+		return fmt.Errorf("short write to %s: %d/%d", g.endpoints[idx], n, len(b))
 	}
 	return nil
 }
 
-// reconnect attempts to (re-)establish a TCP connection to the Graphite server.
-func (g *Graphite) reconnect() error {
-	conn, err := net.Dial("tcp", g.endpoint)
+// reconnect attempts to (re-)establish a connection to the endpoint at idx.
+func (g *Graphite) reconnect(idx int) error {
+	conn, err := g.dialer.Dial(g.protocol, g.endpoints[idx])
 	if err != nil {
 		return err
 	}
-	g.connection = conn
+	g.endpointConns[idx] = conn
+	g.stats.Reconnects.Add(1)
 	return nil
 }
 
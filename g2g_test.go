@@ -0,0 +1,44 @@
+package g2g
+
+import (
+	"testing"
+	"time"
+)
+
+// TestEnqueueBlockUnblocksOnClosing guards against a Block-policy
+// enqueue wedging forever when the queue never drains: it should give
+// up (and count a drop) as soon as g.closing is closed, rather than
+// blocking indefinitely and deadlocking Shutdown.
+func TestEnqueueBlockUnblocksOnClosing(t *testing.T) {
+	g := &Graphite{
+		queue:   make(chan []byte, 1),
+		onFull:  Block,
+		closing: make(chan struct{}),
+		stats:   newStats(),
+	}
+	g.queue <- []byte("already queued\n") // fill the only slot; nothing drains it
+
+	done := make(chan struct{})
+	go func() {
+		g.enqueue([]byte("second batch\n"))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("enqueue returned before the queue had room or closing was closed")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(g.closing)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("enqueue did not return after g.closing was closed")
+	}
+
+	if got := g.stats.Dropped.Value(); got != 1 {
+		t.Fatalf("Dropped = %d, want 1", got)
+	}
+}
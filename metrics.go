@@ -0,0 +1,150 @@
+package g2g
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultHistogramWindows is how many consecutive flushes a Histogram
+// sample contributes to before aging out, absent an explicit value via
+// NewHistogramWindow. Ten gives a few minutes of smoothing at typical
+// publish intervals without samples lingering indefinitely.
+const defaultHistogramWindows = 10
+
+// Counter is an integer client-side count metric. Construct
+// one with Graphite.NewCounter; its current value is published every
+// interval without the caller managing an expvar directly.
+type Counter struct {
+	v int64
+}
+
+// NewCounter creates a Counter, Registers it under name, and returns it.
+func (g *Graphite) NewCounter(name string) *Counter {
+	c := &Counter{}
+	g.Register(name, c)
+	return c
+}
+
+// Add adds delta, which may be negative, to the counter.
+func (c *Counter) Add(delta int64) {
+	atomic.AddInt64(&c.v, delta)
+}
+
+// Inc increments the counter by 1.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// String implements expvar.Var.
+func (c *Counter) String() string {
+	return strconv.FormatInt(atomic.LoadInt64(&c.v), 10)
+}
+
+// Gauge is a client-side metric that holds an arbitrary float64 value.
+// Construct one with Graphite.NewGauge.
+type Gauge struct {
+	bits uint64
+}
+
+// NewGauge creates a Gauge, Registers it under name, and returns it.
+func (g *Graphite) NewGauge(name string) *Gauge {
+	gg := &Gauge{}
+	g.Register(name, gg)
+	return gg
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
+}
+
+// Add adds delta, which may be negative, to the gauge's current value.
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&g.bits)
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(&g.bits, old, next) {
+			return
+		}
+	}
+}
+
+// String implements expvar.Var.
+func (g *Gauge) String() string {
+	return strconv.FormatFloat(math.Float64frombits(atomic.LoadUint64(&g.bits)), 'g', -1, 64)
+}
+
+// Histogram records observations in a ring of sub-histograms rotated on
+// each flush, so an observation contributes to a bounded number of
+// consecutive publish intervals before aging out. Construct one with
+// Graphite.NewHistogram or NewHistogramWindow.
+type Histogram struct {
+	mu      sync.Mutex
+	windows [][]float64
+	cursor  int
+}
+
+// NewHistogram creates a Histogram with the default window depth,
+// RegisterMultis it under name, and returns it.
+func (g *Graphite) NewHistogram(name string) *Histogram {
+	return g.NewHistogramWindow(name, defaultHistogramWindows)
+}
+
+// NewHistogramWindow is like NewHistogram, but lets the caller pick how
+// many consecutive flushes each observation survives for.
+func (g *Graphite) NewHistogramWindow(name string, windows int) *Histogram {
+	if windows < 1 {
+		windows = 1
+	}
+	h := &Histogram{windows: make([][]float64, windows)}
+	g.RegisterMulti(name, h)
+	return h
+}
+
+// Observe records a single sample.
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	h.windows[h.cursor] = append(h.windows[h.cursor], v)
+	h.mu.Unlock()
+}
+
+// Strings implements MultiVar. It merges every window's samples,
+// rotates the ring so the oldest window is cleared and becomes the new
+// write target, and emits count, sum, and p50/p90/p95/p99 lines.
+func (h *Histogram) Strings() map[string]string {
+	h.mu.Lock()
+	var samples []float64
+	for _, w := range h.windows {
+		samples = append(samples, w...)
+	}
+	h.cursor = (h.cursor + 1) % len(h.windows)
+	h.windows[h.cursor] = nil
+	h.mu.Unlock()
+
+	sort.Float64s(samples)
+	var sum float64
+	for _, v := range samples {
+		sum += v
+	}
+	return map[string]string{
+		".count": strconv.Itoa(len(samples)),
+		".sum":   strconv.FormatFloat(sum, 'g', -1, 64),
+		".p50":   formatQuantile(samples, 0.50),
+		".p90":   formatQuantile(samples, 0.90),
+		".p95":   formatQuantile(samples, 0.95),
+		".p99":   formatQuantile(samples, 0.99),
+	}
+}
+
+// formatQuantile returns the q-quantile of sorted (already ascending),
+// or "0" if there are no samples.
+func formatQuantile(sorted []float64, q float64) string {
+	if len(sorted) == 0 {
+		return "0"
+	}
+	idx := int(q * float64(len(sorted)-1))
+	return strconv.FormatFloat(sorted[idx], 'g', -1, 64)
+}
@@ -0,0 +1,47 @@
+package g2g
+
+import "testing"
+
+func TestCounterAddInc(t *testing.T) {
+	c := &Counter{}
+	c.Inc()
+	c.Add(4)
+	if got, want := c.String(), "5"; got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestGaugeSetAdd(t *testing.T) {
+	g := &Gauge{}
+	g.Set(1.5)
+	g.Add(-0.5)
+	if got, want := g.String(), "1"; got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestHistogramQuantilesAndRotation(t *testing.T) {
+	h := &Histogram{windows: make([][]float64, 2)}
+	for i := 1; i <= 100; i++ {
+		h.Observe(float64(i))
+	}
+
+	got := h.Strings()
+	if got[".count"] != "100" {
+		t.Fatalf(".count = %q, want 100", got[".count"])
+	}
+	if got[".p50"] != "50" {
+		t.Fatalf(".p50 = %q, want 50", got[".p50"])
+	}
+	if got[".p99"] != "99" {
+		t.Fatalf(".p99 = %q, want 99", got[".p99"])
+	}
+
+	// Each Strings() call rotates the ring by one window; after two
+	// more calls the original 100 samples have aged out entirely.
+	h.Strings()
+	empty := h.Strings()
+	if empty[".count"] != "0" {
+		t.Fatalf(".count after two rotations = %q, want 0", empty[".count"])
+	}
+}
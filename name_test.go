@@ -0,0 +1,79 @@
+package g2g
+
+import "testing"
+
+func TestRenderName(t *testing.T) {
+	cases := []struct {
+		name       string
+		prefix     string
+		nameMapper func(string) string
+		in         string
+		want       string
+	}{
+		{name: "no prefix or mapper", in: "requests.count", want: "requests.count"},
+		{name: "prefix only", prefix: "myapp.", in: "requests.count", want: "myapp.requests.count"},
+		{
+			name:       "mapper only",
+			nameMapper: func(s string) string { return "mapped." + s },
+			in:         "requests.count",
+			want:       "mapped.requests.count",
+		},
+		{
+			name:       "mapper runs before prefix is prepended",
+			prefix:     "myapp.",
+			nameMapper: func(s string) string { return "mapped." + s },
+			in:         "requests.count",
+			want:       "myapp.mapped.requests.count",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := &Graphite{prefix: c.prefix, nameMapper: c.nameMapper}
+			if got := g.renderName(c.in); got != c.want {
+				t.Errorf("renderName(%q) = %q, want %q", c.in, got, c.want)
+			}
+		})
+	}
+}
+
+func TestRenderNameWithTags(t *testing.T) {
+	cases := []struct {
+		name         string
+		prefix       string
+		tagSeparator string
+		tags         map[string]string
+		want         string
+	}{
+		{
+			name: "no tags falls back to renderName",
+			want: "requests.count",
+		},
+		{
+			name:         "tags sorted by key with default separator",
+			tagSeparator: ";",
+			tags:         map[string]string{"host": "a", "env": "prod"},
+			want:         "requests.count;env=prod;host=a",
+		},
+		{
+			name:         "prefix applies before the tag block",
+			prefix:       "myapp.",
+			tagSeparator: ";",
+			tags:         map[string]string{"env": "prod"},
+			want:         "myapp.requests.count;env=prod",
+		},
+		{
+			name:         "custom separator",
+			tagSeparator: ",",
+			tags:         map[string]string{"env": "prod"},
+			want:         "requests.count,env=prod",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := &Graphite{prefix: c.prefix, tagSeparator: c.tagSeparator}
+			if got := g.renderNameWithTags("requests.count", c.tags); got != c.want {
+				t.Errorf("renderNameWithTags(%q) = %q, want %q", "requests.count", got, c.want)
+			}
+		})
+	}
+}